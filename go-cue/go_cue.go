@@ -2,129 +2,851 @@ package main
 
 /*
 #include <stdint.h>
+#include <stdlib.h>
 
+typedef uintptr_t CueContextAddr;
 typedef uintptr_t CueValueAddr;
+typedef uintptr_t CueErrorAddr;
+
+// CueBuffer is a length-prefixed byte buffer: ptr/len can carry arbitrary
+// bytes (including embedded NULs, which JSON/YAML/CUE payloads may legally
+// contain), and the caller must release ptr with cue_buffer_free. err is a
+// CueErrorAddr, or 0 if the call succeeded.
+typedef struct {
+	char *ptr;
+	size_t len;
+	uintptr_t err;
+} CueBuffer;
 */
 import "C"
 
 import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
 	"sync"
+	"unsafe"
 
 	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/ast"
 	"cuelang.org/go/cue/cuecontext"
+	cueerrors "cuelang.org/go/cue/errors"
+	cueformat "cuelang.org/go/cue/format"
+	"cuelang.org/go/cue/load"
+	"cuelang.org/go/cue/token"
+	cuejson "cuelang.org/go/encoding/json"
+	"cuelang.org/go/encoding/jsonschema"
+	"cuelang.org/go/encoding/protobuf"
+	cuetoml "cuelang.org/go/encoding/toml"
 	cueyaml "cuelang.org/go/encoding/yaml"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
 )
 
+// invalidValueAddr is returned by operations that cannot produce a usable
+// value, e.g. an unknown handle or a cross-context unify.
+const invalidValueAddr C.CueValueAddr = 0
+
+// noError is the CueErrorAddr returned alongside a successful result.
+const noError C.CueErrorAddr = 0
+
+// CueContext wraps a single *cue.Context. Every cue.Value produced by this
+// library belongs to exactly one CueContext, so isolated schemas and
+// concurrent evaluation with different builtins/loaders are possible by
+// simply creating more than one.
 type CueContext struct {
-	mu sync.Mutex
-	// cueCtx is a shared CUE context. Values produced by different contexts cannot
-	// be mixed, so we use a single global instance for the lifetime of the library.
-	ctx    *cue.Context
+	ctx *cue.Context
+}
+
+// contextRegistry holds every live CueContext, keyed by the handle returned
+// from cue_context_new.
+var contextRegistry = struct {
+	mu     sync.Mutex
+	ctxs   map[uintptr]*CueContext
+	nextID uintptr
+}{
+	ctxs:   make(map[uintptr]*CueContext),
+	nextID: 1,
+}
+
+// valueRegistry holds every live cue.Value across all contexts, keyed by the
+// handle returned from cue_value_new and friends. Values carry their owning
+// *cue.Context internally (cue.Value.Context()), which is what lets
+// operations that combine two values detect a context mismatch.
+var valueRegistry = struct {
+	mu     sync.Mutex
 	values map[uintptr]cue.Value
 	nextID uintptr
+}{
+	values: make(map[uintptr]cue.Value),
+	nextID: 1,
 }
 
-func (ctx *CueContext) new_value(v cue.Value) C.CueValueAddr {
-	ctx.mu.Lock()
-	ctx.nextID++
-	addr := ctx.nextID
-	ctx.values[addr] = v
-	ctx.mu.Unlock()
+func registerContext(ctx *cue.Context) C.CueContextAddr {
+	contextRegistry.mu.Lock()
+	defer contextRegistry.mu.Unlock()
+	addr := contextRegistry.nextID
+	contextRegistry.nextID++
+	contextRegistry.ctxs[addr] = &CueContext{ctx: ctx}
+	return C.CueContextAddr(addr)
+}
+
+func getContext(addr C.CueContextAddr) *CueContext {
+	contextRegistry.mu.Lock()
+	defer contextRegistry.mu.Unlock()
+	return contextRegistry.ctxs[uintptr(addr)]
+}
+
+func freeContext(addr C.CueContextAddr) {
+	contextRegistry.mu.Lock()
+	defer contextRegistry.mu.Unlock()
+	delete(contextRegistry.ctxs, uintptr(addr))
+}
+
+func newValue(v cue.Value) C.CueValueAddr {
+	valueRegistry.mu.Lock()
+	defer valueRegistry.mu.Unlock()
+	addr := valueRegistry.nextID
+	valueRegistry.nextID++
+	valueRegistry.values[addr] = v
 	return C.CueValueAddr(addr)
 }
 
-func (ctx *CueContext) get_value(addr C.CueValueAddr) *cue.Value {
-	ctx.mu.Lock()
-	v, ok := ctx.values[uintptr(addr)]
-	ctx.mu.Unlock()
+func getValue(addr C.CueValueAddr) *cue.Value {
+	valueRegistry.mu.Lock()
+	defer valueRegistry.mu.Unlock()
+	v, ok := valueRegistry.values[uintptr(addr)]
 	if !ok {
 		return nil
 	}
 	return &v
 }
 
-func (ctx *CueContext) remove_value(addr C.CueValueAddr) {
-	ctx.mu.Lock()
-	delete(ctx.values, uintptr(addr))
-	ctx.mu.Unlock()
+func freeValue(addr C.CueValueAddr) {
+	valueRegistry.mu.Lock()
+	defer valueRegistry.mu.Unlock()
+	delete(valueRegistry.values, uintptr(addr))
 }
 
-var cueCtx = CueContext{
-	ctx:    cuecontext.New(),
-	values: make(map[uintptr]cue.Value),
+// errorRegistry holds every live error list, keyed by the handle returned
+// from registerError. Each entry is the fully expanded set of individual
+// errors.Error values backing a (possibly multi-) error, so callers can walk
+// positions and paths per-error instead of parsing a flattened string.
+var errorRegistry = struct {
+	mu     sync.Mutex
+	errs   map[uintptr][]cueerrors.Error
+	nextID uintptr
+}{
+	errs:   make(map[uintptr][]cueerrors.Error),
 	nextID: 1,
 }
 
+// registerError stores err for later inspection via the cue_error_* exports
+// and returns noError if err is nil.
+func registerError(err error) C.CueErrorAddr {
+	if err == nil {
+		return noError
+	}
+	errorRegistry.mu.Lock()
+	defer errorRegistry.mu.Unlock()
+	addr := errorRegistry.nextID
+	errorRegistry.nextID++
+	errorRegistry.errs[addr] = cueerrors.Errors(err)
+	return C.CueErrorAddr(addr)
+}
+
+func getErrors(addr C.CueErrorAddr) []cueerrors.Error {
+	errorRegistry.mu.Lock()
+	defer errorRegistry.mu.Unlock()
+	return errorRegistry.errs[uintptr(addr)]
+}
+
+// goStrings converts a cgo array of C strings (as passed from Rust, e.g.
+// `*const *const c_char` with a length) into a []string.
+func goStrings(arr **C.char, count C.int) []string {
+	out := make([]string, int(count))
+	for i, s := range unsafe.Slice(arr, int(count)) {
+		out[i] = C.GoString(s)
+	}
+	return out
+}
+
+// newBuffer copies data into a C-allocated CueBuffer the caller owns via
+// cue_buffer_free.
+func newBuffer(data []byte) C.CueBuffer {
+	if len(data) == 0 {
+		return C.CueBuffer{}
+	}
+	return C.CueBuffer{
+		ptr: (*C.char)(C.CBytes(data)),
+		len: C.size_t(len(data)),
+		err: C.uintptr_t(noError),
+	}
+}
+
+// errBuffer builds a CueBuffer carrying no payload, with err registered for
+// later inspection via the cue_error_* exports.
+func errBuffer(err error) C.CueBuffer {
+	return C.CueBuffer{err: C.uintptr_t(registerError(err))}
+}
+
+// addrsToC copies addrs into a C-allocated array the caller owns, since a Go
+// slice cannot be handed across the cgo boundary and outlive this call.
+func addrsToC(addrs []C.CueValueAddr) *C.CueValueAddr {
+	if len(addrs) == 0 {
+		return nil
+	}
+	size := C.size_t(len(addrs)) * C.size_t(unsafe.Sizeof(addrs[0]))
+	ptr := (*C.CueValueAddr)(C.malloc(size))
+	copy(unsafe.Slice(ptr, len(addrs)), addrs)
+	return ptr
+}
+
+//export cue_context_new
+func cue_context_new() C.CueContextAddr {
+	return registerContext(cuecontext.New())
+}
+
+//export cue_context_free
+func cue_context_free(addr C.CueContextAddr) {
+	freeContext(addr)
+}
+
 //export cue_value_new
-func cue_value_new(input *C.char) C.CueValueAddr {
+func cue_value_new(ctxAddr C.CueContextAddr, input *C.char) C.CueValueAddr {
+	ctx := getContext(ctxAddr)
+	if ctx == nil {
+		return invalidValueAddr
+	}
 	s := C.GoString(input)
-	v := cueCtx.ctx.CompileString(s)
-	return cueCtx.new_value(v)
+	v := ctx.ctx.CompileString(s)
+	return newValue(v)
 }
 
 //export cue_value_free
 func cue_value_free(addr C.CueValueAddr) {
-	cueCtx.remove_value(addr)
+	freeValue(addr)
 }
 
-// <https://pkg.go.dev/cuelang.org/go/cue#Value.Validate>
+//export cue_error_free
+func cue_error_free(addr C.CueErrorAddr) {
+	errorRegistry.mu.Lock()
+	defer errorRegistry.mu.Unlock()
+	delete(errorRegistry.errs, uintptr(addr))
+}
+
+// cue_buffer_free releases a CueBuffer's payload. It is a no-op if ptr is
+// nil, so it is always safe to call on any CueBuffer an export returned.
 //
-//export cue_value_validate
-func cue_value_validate(addr C.CueValueAddr) *C.char {
-	v := cueCtx.get_value(addr)
-	if v == nil {
-		return C.CString("unknown handle")
+//export cue_buffer_free
+func cue_buffer_free(buf C.CueBuffer) {
+	if buf.ptr != nil {
+		C.free(unsafe.Pointer(buf.ptr))
 	}
-	if err := v.Validate(cue.Concrete(true)); err != nil {
-		return C.CString(err.Error())
+}
+
+// <https://pkg.go.dev/cuelang.org/go/cue/errors#Errors>
+//
+//export cue_error_count
+func cue_error_count(addr C.CueErrorAddr) C.int {
+	return C.int(len(getErrors(addr)))
+}
+
+// cue_error_at returns the message of the idx'th error.
+//
+//export cue_error_at
+func cue_error_at(addr C.CueErrorAddr, idx C.int) C.CueBuffer {
+	errs := getErrors(addr)
+	if idx < 0 || int(idx) >= len(errs) {
+		return errBuffer(fmt.Errorf("error index %d out of range", idx))
+	}
+	return newBuffer([]byte(errs[idx].Error()))
+}
+
+// <https://pkg.go.dev/cuelang.org/go/cue/errors#Error>
+//
+//export cue_error_path
+func cue_error_path(addr C.CueErrorAddr, idx C.int) C.CueBuffer {
+	errs := getErrors(addr)
+	if idx < 0 || int(idx) >= len(errs) {
+		return errBuffer(fmt.Errorf("error index %d out of range", idx))
 	}
-	return C.CString("")
+	return newBuffer([]byte(strings.Join(errs[idx].Path(), ".")))
 }
 
-// <https://pkg.go.dev/cuelang.org/go/cue#Value.MarshalJSON>
+// cue_error_positions returns the idx'th error's positions, formatted one per
+// line, most specific first.
+//
+// <https://pkg.go.dev/cuelang.org/go/cue/errors#Positions>
 //
-//export cue_value_to_json
-func cue_value_to_json(addr C.CueValueAddr) *C.char {
-	v := cueCtx.get_value(addr)
+//export cue_error_positions
+func cue_error_positions(addr C.CueErrorAddr, idx C.int) C.CueBuffer {
+	errs := getErrors(addr)
+	if idx < 0 || int(idx) >= len(errs) {
+		return errBuffer(fmt.Errorf("error index %d out of range", idx))
+	}
+	positions := cueerrors.Positions(errs[idx])
+	lines := make([]string, len(positions))
+	for i, p := range positions {
+		lines[i] = p.String()
+	}
+	return newBuffer([]byte(strings.Join(lines, "\n")))
+}
+
+// <https://pkg.go.dev/cuelang.org/go/cue#Value.Validate>
+//
+//export cue_value_validate
+func cue_value_validate(addr C.CueValueAddr) (C.CueValueAddr, C.CueErrorAddr) {
+	v := getValue(addr)
 	if v == nil {
-		return nil
+		return invalidValueAddr, registerError(fmt.Errorf("unknown handle"))
 	}
-	data, err := v.MarshalJSON()
-	if err != nil {
-		return nil
+	if err := v.Validate(cue.Concrete(true)); err != nil {
+		return addr, registerError(err)
 	}
-	return C.CString(string(data))
+	return addr, noError
 }
 
-// <https://pkg.go.dev/cuelang.org/go/encoding/yaml#Encode>
+// cue_value_encode_as renders addr in the given format, one of "json",
+// "yaml", "cue", or "toml". It replaces the former cue_value_to_json and
+// cue_value_to_yaml exports with a single typed encoder, returning a
+// CueBuffer so the caller can release the memory Go allocated and receive
+// arbitrary byte payloads (a JSON/YAML/CUE payload may legally embed NULs).
 //
-//export cue_value_to_yaml
-func cue_value_to_yaml(addr C.CueValueAddr) *C.char {
-	v := cueCtx.get_value(addr)
+//export cue_value_encode_as
+func cue_value_encode_as(addr C.CueValueAddr, format *C.char) C.CueBuffer {
+	v := getValue(addr)
 	if v == nil {
-		return nil
+		return errBuffer(fmt.Errorf("unknown handle"))
 	}
-	data, err := cueyaml.Encode(*v)
-	if err != nil {
-		return nil
+	switch f := C.GoString(format); f {
+	case "json":
+		// <https://pkg.go.dev/cuelang.org/go/cue#Value.MarshalJSON>
+		data, err := v.MarshalJSON()
+		if err != nil {
+			return errBuffer(err)
+		}
+		return newBuffer(data)
+	case "yaml":
+		// <https://pkg.go.dev/cuelang.org/go/encoding/yaml#Encode>
+		data, err := cueyaml.Encode(*v)
+		if err != nil {
+			return errBuffer(err)
+		}
+		return newBuffer(data)
+	case "cue":
+		// <https://pkg.go.dev/cuelang.org/go/cue/format#Node>
+		data, err := cueformat.Node(v.Syntax(cue.Final(), cue.Docs(true)))
+		if err != nil {
+			return errBuffer(err)
+		}
+		return newBuffer(data)
+	case "toml":
+		// <https://pkg.go.dev/cuelang.org/go/encoding/toml#Encoder>
+		var buf bytes.Buffer
+		if err := cuetoml.NewEncoder(&buf).Encode(*v); err != nil {
+			return errBuffer(err)
+		}
+		return newBuffer(buf.Bytes())
+	default:
+		return errBuffer(fmt.Errorf("unknown encoding format %q", f))
 	}
-	return C.CString(string(data))
 }
 
 // <https://pkg.go.dev/cuelang.org/go/cue#Value.Unify>
 //
+// Values from different contexts can never be unified - CUE itself enforces
+// this ("value not from same runtime") since each context owns an
+// independent runtime - so a mismatch here is rejected rather than silently
+// producing a bogus value. The contexts being compared are derived from the
+// values themselves (cue.Value.Context()), not from a separately-passed
+// handle, so this can't spuriously reject two values that do share a
+// context.
+//
 //export cue_value_unify
-func cue_value_unify(addr1 C.CueValueAddr, addr2 C.CueValueAddr) C.CueValueAddr {
-	v1 := cueCtx.get_value(addr1)
+func cue_value_unify(addr1 C.CueValueAddr, addr2 C.CueValueAddr) (C.CueValueAddr, C.CueErrorAddr) {
+	v1 := getValue(addr1)
 	if v1 == nil {
-		return addr1
+		return invalidValueAddr, registerError(fmt.Errorf("unknown handle"))
 	}
-	v2 := cueCtx.get_value(addr2)
+	v2 := getValue(addr2)
 	if v2 == nil {
-		return addr2
+		return invalidValueAddr, registerError(fmt.Errorf("unknown handle"))
+	}
+	if v1.Context() != v2.Context() {
+		return invalidValueAddr, registerError(fmt.Errorf("value not from same runtime"))
 	}
 	new_v := v1.Unify(*v2)
-	return cueCtx.new_value(new_v)
+	if err := new_v.Err(); err != nil {
+		return invalidValueAddr, registerError(err)
+	}
+	return newValue(new_v), noError
+}
+
+// buildInstance loads the instances load.Instances produces and builds the
+// first of them against ctx, reporting load and build errors the same way.
+// Any further instances are ignored.
+func buildInstance(ctx *CueContext, args []string, cfg *load.Config) (C.CueValueAddr, C.CueErrorAddr) {
+	instances := load.Instances(args, cfg)
+	if len(instances) == 0 {
+		return invalidValueAddr, registerError(fmt.Errorf("no instances found"))
+	}
+	inst := instances[0]
+	if inst.Err != nil {
+		return invalidValueAddr, registerError(inst.Err)
+	}
+	v := ctx.ctx.BuildInstance(inst)
+	if v.Err() != nil {
+		return invalidValueAddr, registerError(v.Err())
+	}
+	return newValue(v), noError
+}
+
+// <https://pkg.go.dev/cuelang.org/go/cue/load#Instances>
+//
+//export cue_value_load_instance
+func cue_value_load_instance(ctxAddr C.CueContextAddr, dir *C.char, pkg *C.char) (C.CueValueAddr, C.CueErrorAddr) {
+	ctx := getContext(ctxAddr)
+	if ctx == nil {
+		return invalidValueAddr, registerError(fmt.Errorf("unknown context handle"))
+	}
+	cfg := &load.Config{
+		Dir:     C.GoString(dir),
+		Package: C.GoString(pkg),
+	}
+	return buildInstance(ctx, []string{"."}, cfg)
+}
+
+// <https://pkg.go.dev/cuelang.org/go/cue/load#Instances>
+//
+//export cue_value_build_files
+func cue_value_build_files(ctxAddr C.CueContextAddr, filenames **C.char, count C.int) (C.CueValueAddr, C.CueErrorAddr) {
+	ctx := getContext(ctxAddr)
+	if ctx == nil {
+		return invalidValueAddr, registerError(fmt.Errorf("unknown context handle"))
+	}
+	return buildInstance(ctx, goStrings(filenames, count), nil)
+}
+
+// fillPath implements cue_value_fill_path in terms of plain Go strings, so
+// it can be exercised by tests without going through the cgo boundary.
+func fillPath(v *cue.Value, path string, jsonOrCue string) (C.CueValueAddr, C.CueErrorAddr) {
+	p := cue.ParsePath(path)
+	if p.Err() != nil {
+		return invalidValueAddr, registerError(p.Err())
+	}
+	x := v.Context().CompileString(jsonOrCue)
+	if x.Err() != nil {
+		return invalidValueAddr, registerError(x.Err())
+	}
+	filled := v.FillPath(p, x)
+	if err := filled.Err(); err != nil {
+		return invalidValueAddr, registerError(err)
+	}
+	return newValue(filled), noError
+}
+
+// <https://pkg.go.dev/cuelang.org/go/cue#Value.FillPath>
+//
+//export cue_value_fill_path
+func cue_value_fill_path(addr C.CueValueAddr, path *C.char, jsonOrCue *C.char) (C.CueValueAddr, C.CueErrorAddr) {
+	v := getValue(addr)
+	if v == nil {
+		return invalidValueAddr, registerError(fmt.Errorf("unknown handle"))
+	}
+	return fillPath(v, C.GoString(path), C.GoString(jsonOrCue))
+}
+
+// lookupPath implements cue_value_lookup_path in terms of a plain Go
+// string, so it can be exercised by tests without going through the cgo
+// boundary.
+func lookupPath(v *cue.Value, path string) (C.CueValueAddr, C.CueErrorAddr) {
+	p := cue.ParsePath(path)
+	if p.Err() != nil {
+		return invalidValueAddr, registerError(p.Err())
+	}
+	looked := v.LookupPath(p)
+	if err := looked.Err(); err != nil {
+		return invalidValueAddr, registerError(err)
+	}
+	return newValue(looked), noError
+}
+
+// <https://pkg.go.dev/cuelang.org/go/cue#Value.LookupPath>
+//
+//export cue_value_lookup_path
+func cue_value_lookup_path(addr C.CueValueAddr, path *C.char) (C.CueValueAddr, C.CueErrorAddr) {
+	v := getValue(addr)
+	if v == nil {
+		return invalidValueAddr, registerError(fmt.Errorf("unknown handle"))
+	}
+	return lookupPath(v, C.GoString(path))
+}
+
+// <https://pkg.go.dev/cuelang.org/go/encoding/yaml#Validate>
+//
+// cue_value_validate_yaml validates every "---"-separated document in
+// yamlBytes against the schema value at schemaAddr, collecting the errors of
+// every failing document rather than stopping at the first. A document with
+// several failures contributes one error per failure. A document that the
+// decoder cannot extract ends the scan; later documents are not checked.
+//
+//export cue_value_validate_yaml
+func cue_value_validate_yaml(schemaAddr C.CueValueAddr, yamlBytes *C.char, length C.int) C.CueErrorAddr {
+	schema := getValue(schemaAddr)
+	if schema == nil {
+		return registerError(fmt.Errorf("unknown handle"))
+	}
+	raw := C.GoBytes(unsafe.Pointer(yamlBytes), length)
+	dec := cueyaml.NewDecoder("yaml", bytes.NewReader(raw))
+	var list cueerrors.Error
+	for {
+		expr, err := dec.Extract()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			list = cueerrors.Append(list, cueerrors.Promote(err, "decode"))
+			break
+		}
+		v := schema.Context().BuildExpr(expr)
+		if v.Err() != nil {
+			list = cueerrors.Append(list, cueerrors.Promote(v.Err(), "decode"))
+			continue
+		}
+		if err := schema.Unify(v).Validate(cue.Concrete(true)); err != nil {
+			list = cueerrors.Append(list, cueerrors.Promote(err, "validate"))
+		}
+	}
+	if list == nil {
+		return noError
+	}
+	return registerError(list)
+}
+
+// <https://pkg.go.dev/cuelang.org/go/encoding/json#Validate>
+//
+//export cue_value_validate_json
+func cue_value_validate_json(schemaAddr C.CueValueAddr, jsonBytes *C.char, length C.int) C.CueErrorAddr {
+	schema := getValue(schemaAddr)
+	if schema == nil {
+		return registerError(fmt.Errorf("unknown handle"))
+	}
+	raw := C.GoBytes(unsafe.Pointer(jsonBytes), length)
+	if err := cuejson.Validate(raw, *schema); err != nil {
+		return registerError(err)
+	}
+	return noError
+}
+
+// <https://pkg.go.dev/cuelang.org/go/encoding/yaml#NewDecoder>
+//
+// cue_value_from_yaml_stream splits a "---"-separated YAML stream into one
+// CueValueAddr per document, for callers (e.g. validating a directory of
+// Kubernetes manifests) that would otherwise have to concatenate documents
+// into a single CUE expression. If a later document fails to parse or build,
+// the documents already registered are still returned alongside the error so
+// the caller can free them instead of leaking the handles.
+//
+//export cue_value_from_yaml_stream
+func cue_value_from_yaml_stream(ctxAddr C.CueContextAddr, data *C.char, length C.int) (*C.CueValueAddr, C.int, C.CueErrorAddr) {
+	ctx := getContext(ctxAddr)
+	if ctx == nil {
+		return nil, 0, registerError(fmt.Errorf("unknown context handle"))
+	}
+	raw := C.GoBytes(unsafe.Pointer(data), length)
+	dec := cueyaml.NewDecoder("stream", bytes.NewReader(raw))
+	var addrs []C.CueValueAddr
+	for {
+		expr, err := dec.Extract()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return addrsToC(addrs), C.int(len(addrs)), registerError(err)
+		}
+		v := ctx.ctx.BuildExpr(expr)
+		if v.Err() != nil {
+			return addrsToC(addrs), C.int(len(addrs)), registerError(v.Err())
+		}
+		addrs = append(addrs, newValue(v))
+	}
+	return addrsToC(addrs), C.int(len(addrs)), noError
+}
+
+// <https://pkg.go.dev/cuelang.org/go/cue#Context.CompileBytes>
+//
+// cue_value_from_go_value is the analog of gocodec's FromGoValue for a
+// non-Go host language: it decodes a serialized value (JSON) into a CUE
+// value, so it can be checked against a schema with cue_value_unify.
+//
+//export cue_value_from_go_value
+func cue_value_from_go_value(ctxAddr C.CueContextAddr, data *C.char, length C.int) (C.CueValueAddr, C.CueErrorAddr) {
+	ctx := getContext(ctxAddr)
+	if ctx == nil {
+		return invalidValueAddr, registerError(fmt.Errorf("unknown context handle"))
+	}
+	raw := C.GoBytes(unsafe.Pointer(data), length)
+	v := ctx.ctx.CompileBytes(raw)
+	if v.Err() != nil {
+		return invalidValueAddr, registerError(v.Err())
+	}
+	return newValue(v), noError
+}
+
+// cue_value_from_go_type is the analog of gocodec's FromGoType for a non-Go
+// host language: it derives a CUE schema from a serialized type descriptor.
+// kind selects how descriptor is interpreted: "jsonschema" for a JSON Schema
+// document, "protobuf" for .proto IDL source text describing the message
+// types, or "protobuf-descriptor" for a serialized
+// google.protobuf.FileDescriptorProto (what protoc/prost-style tooling
+// emits).
+//
+//export cue_value_from_go_type
+func cue_value_from_go_type(ctxAddr C.CueContextAddr, kind *C.char, descriptor *C.char, length C.int) (C.CueValueAddr, C.CueErrorAddr) {
+	ctx := getContext(ctxAddr)
+	if ctx == nil {
+		return invalidValueAddr, registerError(fmt.Errorf("unknown context handle"))
+	}
+	raw := C.GoBytes(unsafe.Pointer(descriptor), length)
+	switch k := C.GoString(kind); k {
+	case "jsonschema":
+		// <https://pkg.go.dev/cuelang.org/go/encoding/jsonschema#Extract>
+		schema := ctx.ctx.CompileBytes(raw)
+		if schema.Err() != nil {
+			return invalidValueAddr, registerError(schema.Err())
+		}
+		file, err := jsonschema.Extract(schema, &jsonschema.Config{})
+		if err != nil {
+			return invalidValueAddr, registerError(err)
+		}
+		v := ctx.ctx.BuildFile(file)
+		if v.Err() != nil {
+			return invalidValueAddr, registerError(v.Err())
+		}
+		return newValue(v), noError
+	case "protobuf":
+		// <https://pkg.go.dev/cuelang.org/go/encoding/protobuf#NewExtractor>
+		if bytes.ContainsRune(raw, 0) {
+			return invalidValueAddr, registerError(fmt.Errorf("descriptor looks like a compiled FileDescriptorProto, not .proto source text; use cue_value_from_go_type(\"protobuf-descriptor\", ...) for that"))
+		}
+		extractor := protobuf.NewExtractor(&protobuf.Config{Paths: []string{"."}})
+		if err := extractor.AddFile("descriptor.proto", bytes.NewReader(raw)); err != nil {
+			return invalidValueAddr, registerError(err)
+		}
+		files, err := extractor.Files()
+		if err != nil {
+			return invalidValueAddr, registerError(err)
+		}
+		if len(files) == 0 {
+			return invalidValueAddr, registerError(fmt.Errorf("no message types extracted from descriptor"))
+		}
+		v := ctx.ctx.BuildFile(files[0])
+		if v.Err() != nil {
+			return invalidValueAddr, registerError(v.Err())
+		}
+		return newValue(v), noError
+	case "protobuf-descriptor":
+		// <https://pkg.go.dev/google.golang.org/protobuf/types/descriptorpb#FileDescriptorProto>
+		fd := &descriptorpb.FileDescriptorProto{}
+		if err := proto.Unmarshal(raw, fd); err != nil {
+			return invalidValueAddr, registerError(fmt.Errorf("decoding FileDescriptorProto: %w", err))
+		}
+		file, err := protoDescriptorToCUEFile(fd)
+		if err != nil {
+			return invalidValueAddr, registerError(err)
+		}
+		v := ctx.ctx.BuildFile(file)
+		if v.Err() != nil {
+			return invalidValueAddr, registerError(v.Err())
+		}
+		return newValue(v), noError
+	default:
+		return invalidValueAddr, registerError(fmt.Errorf("unsupported type descriptor kind %q", k))
+	}
+}
+
+// protoDescriptorToCUEFile maps every message type declared in fd (including
+// ones nested inside other messages) to a top-level CUE definition, using
+// the same proto-to-CUE type mapping as
+// cuelang.org/go/encoding/protobuf: <https://pkg.go.dev/cuelang.org/go/encoding/protobuf>.
+// This only resolves types declared in fd itself; a field referencing a
+// message or enum from an imported .proto file is reported as an error,
+// since the dependency's descriptor isn't available here.
+func protoDescriptorToCUEFile(fd *descriptorpb.FileDescriptorProto) (*ast.File, error) {
+	messages := map[string]*descriptorpb.DescriptorProto{}
+	enums := map[string]*descriptorpb.EnumDescriptorProto{}
+	var order []string
+	collectProtoTypes(protoNamePrefix(fd.GetPackage()), fd.GetMessageType(), fd.GetEnumType(), messages, enums, &order)
+	if len(order) == 0 {
+		return nil, fmt.Errorf("descriptor %q defines no message types", fd.GetName())
+	}
+
+	decls := make([]ast.Decl, 0, len(order))
+	for _, full := range order {
+		fields, err := protoMessageFields(messages[full], messages, enums)
+		if err != nil {
+			return nil, fmt.Errorf("message %q: %w", full, err)
+		}
+		decls = append(decls, &ast.Field{
+			Label: ast.NewIdent(protoDefName(full)),
+			Value: &ast.StructLit{Elts: fields},
+		})
+	}
+	return &ast.File{Filename: fd.GetName(), Decls: decls}, nil
+}
+
+// protoNamePrefix renders a proto package name the way FieldDescriptorProto
+// type names are qualified: empty, or a leading dot followed by the
+// package.
+func protoNamePrefix(pkg string) string {
+	if pkg == "" {
+		return ""
+	}
+	return "." + pkg
+}
+
+// collectProtoTypes walks msgs/enums (and, recursively, every nested type)
+// under prefix, recording each message by its fully-qualified proto name in
+// messages and appending non-synthetic ones (i.e. not a proto map's
+// generated MapEntry) to order in declaration order.
+func collectProtoTypes(prefix string, msgs []*descriptorpb.DescriptorProto, enums []*descriptorpb.EnumDescriptorProto, messages map[string]*descriptorpb.DescriptorProto, enumValues map[string]*descriptorpb.EnumDescriptorProto, order *[]string) {
+	for _, e := range enums {
+		enumValues[prefix+"."+e.GetName()] = e
+	}
+	for _, m := range msgs {
+		full := prefix + "." + m.GetName()
+		messages[full] = m
+		if !m.GetOptions().GetMapEntry() {
+			*order = append(*order, full)
+		}
+		collectProtoTypes(full, m.GetNestedType(), m.GetEnumType(), messages, enumValues, order)
+	}
+}
+
+// protoDefName turns a fully-qualified proto type name (e.g. ".pkg.Outer.Inner")
+// into a CUE definition identifier (e.g. "#pkg_Outer_Inner").
+func protoDefName(full string) string {
+	return "#" + strings.ReplaceAll(strings.TrimPrefix(full, "."), ".", "_")
+}
+
+// protoMessageFields builds the struct fields for msg, following the type
+// mapping documented at
+// <https://pkg.go.dev/cuelang.org/go/encoding/protobuf#hdr-Type_Mappings>.
+func protoMessageFields(msg *descriptorpb.DescriptorProto, messages map[string]*descriptorpb.DescriptorProto, enums map[string]*descriptorpb.EnumDescriptorProto) ([]ast.Decl, error) {
+	decls := make([]ast.Decl, 0, len(msg.GetField()))
+	for _, f := range msg.GetField() {
+		value, isMap, err := protoFieldValue(f, messages, enums)
+		if err != nil {
+			return nil, fmt.Errorf("field %q: %w", f.GetName(), err)
+		}
+		if f.GetLabel() == descriptorpb.FieldDescriptorProto_LABEL_REPEATED && !isMap {
+			value = &ast.ListLit{Elts: []ast.Expr{&ast.Ellipsis{Type: value}}}
+		}
+		name := f.GetJsonName()
+		if name == "" {
+			name = f.GetName()
+		}
+		decls = append(decls, &ast.Field{Label: ast.NewIdent(name), Value: value})
+	}
+	return decls, nil
+}
+
+// protoFieldValue returns the CUE expression for a single field's type. The
+// second return reports whether f is a proto map field, since those are
+// rendered as a struct with a pattern-constraint key rather than wrapped in
+// a CUE list even though the wire format models them as "repeated".
+func protoFieldValue(f *descriptorpb.FieldDescriptorProto, messages map[string]*descriptorpb.DescriptorProto, enums map[string]*descriptorpb.EnumDescriptorProto) (ast.Expr, bool, error) {
+	switch f.GetType() {
+	case descriptorpb.FieldDescriptorProto_TYPE_ENUM:
+		full := f.GetTypeName()
+		en, ok := enums[full]
+		if !ok {
+			return nil, false, fmt.Errorf("unknown or imported enum type %q", full)
+		}
+		expr, err := protoEnumExpr(en)
+		return expr, false, err
+	case descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, descriptorpb.FieldDescriptorProto_TYPE_GROUP:
+		full := f.GetTypeName()
+		msg, ok := messages[full]
+		if !ok {
+			return nil, false, fmt.Errorf("unknown or imported message type %q", full)
+		}
+		if msg.GetOptions().GetMapEntry() {
+			keyExpr, _, err := protoFieldValue(msg.GetField()[0], messages, enums)
+			if err != nil {
+				return nil, false, fmt.Errorf("map key: %w", err)
+			}
+			valExpr, _, err := protoFieldValue(msg.GetField()[1], messages, enums)
+			if err != nil {
+				return nil, false, fmt.Errorf("map value: %w", err)
+			}
+			mapStruct := &ast.StructLit{Elts: []ast.Decl{
+				&ast.Field{Label: &ast.ListLit{Elts: []ast.Expr{keyExpr}}, Value: valExpr},
+			}}
+			return mapStruct, true, nil
+		}
+		return ast.NewIdent(protoDefName(full)), false, nil
+	default:
+		name, ok := protoScalarCUEType(f.GetType())
+		if !ok {
+			return nil, false, fmt.Errorf("unsupported field type %v", f.GetType())
+		}
+		return ast.NewIdent(name), false, nil
+	}
+}
+
+// protoEnumExpr renders a proto enum as the disjunction of its value names,
+// matching the "e1 | e2 | ..." mapping cuelang.org/go/encoding/protobuf uses
+// for .proto source.
+func protoEnumExpr(en *descriptorpb.EnumDescriptorProto) (ast.Expr, error) {
+	values := en.GetValue()
+	if len(values) == 0 {
+		return nil, fmt.Errorf("enum %q has no values", en.GetName())
+	}
+	if len(values) == 1 {
+		return ast.NewString(values[0].GetName()), nil
+	}
+	lits := make([]ast.Expr, len(values))
+	for i, v := range values {
+		lits[i] = ast.NewString(v.GetName())
+	}
+	return ast.NewBinExpr(token.OR, lits...), nil
+}
+
+// protoScalarCUEType maps a proto scalar field type to its CUE identifier,
+// per the table at
+// <https://pkg.go.dev/cuelang.org/go/encoding/protobuf#hdr-Type_Mappings>.
+func protoScalarCUEType(t descriptorpb.FieldDescriptorProto_Type) (string, bool) {
+	switch t {
+	case descriptorpb.FieldDescriptorProto_TYPE_DOUBLE:
+		return "float64", true
+	case descriptorpb.FieldDescriptorProto_TYPE_FLOAT:
+		return "float32", true
+	case descriptorpb.FieldDescriptorProto_TYPE_INT64,
+		descriptorpb.FieldDescriptorProto_TYPE_FIXED64,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED64,
+		descriptorpb.FieldDescriptorProto_TYPE_SINT64:
+		return "int64", true
+	case descriptorpb.FieldDescriptorProto_TYPE_UINT64:
+		return "uint64", true
+	case descriptorpb.FieldDescriptorProto_TYPE_INT32,
+		descriptorpb.FieldDescriptorProto_TYPE_FIXED32,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED32,
+		descriptorpb.FieldDescriptorProto_TYPE_SINT32:
+		return "int32", true
+	case descriptorpb.FieldDescriptorProto_TYPE_UINT32:
+		return "uint32", true
+	case descriptorpb.FieldDescriptorProto_TYPE_BOOL:
+		return "bool", true
+	case descriptorpb.FieldDescriptorProto_TYPE_STRING:
+		return "string", true
+	case descriptorpb.FieldDescriptorProto_TYPE_BYTES:
+		return "bytes", true
+	default:
+		return "", false
+	}
 }
 
 func main() {
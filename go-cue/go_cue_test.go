@@ -0,0 +1,151 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+	"cuelang.org/go/cue/load"
+)
+
+func newTestContext() *CueContext {
+	return &CueContext{ctx: cuecontext.New()}
+}
+
+func writeCUEFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBuildInstanceNoInstances(t *testing.T) {
+	dir := t.TempDir()
+	_, errAddr := buildInstance(newTestContext(), []string{"."}, &load.Config{Dir: dir})
+	if errAddr == noError {
+		t.Fatal("expected an error for a directory with no CUE files")
+	}
+}
+
+func TestBuildInstanceSingle(t *testing.T) {
+	dir := t.TempDir()
+	writeCUEFile(t, dir, "a.cue", "package a\n"+`msg: "hello"`)
+	addr, errAddr := buildInstance(newTestContext(), []string{"."}, &load.Config{Dir: dir})
+	if errAddr != noError {
+		t.Fatalf("unexpected error: %v", getErrors(errAddr))
+	}
+	if getValue(addr) == nil {
+		t.Fatal("expected a registered value")
+	}
+}
+
+// buildInstance only builds load.Instances()[0]; when a pattern expands to
+// more than one instance (e.g. "./..." over several packages), the rest are
+// silently ignored rather than erroring.
+func TestBuildInstanceMultipleInstancesUsesFirst(t *testing.T) {
+	dir := t.TempDir()
+	for _, sub := range []string{"a", "b"} {
+		subdir := filepath.Join(dir, sub)
+		if err := os.Mkdir(subdir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		writeCUEFile(t, subdir, sub+".cue", "package "+sub+"\n"+`value: "`+sub+`"`)
+	}
+
+	instances := load.Instances([]string{"./..."}, &load.Config{Dir: dir})
+	if len(instances) < 2 {
+		t.Fatalf("expected at least 2 instances from ./..., got %d", len(instances))
+	}
+
+	addr, errAddr := buildInstance(newTestContext(), []string{"./..."}, &load.Config{Dir: dir})
+	if errAddr != noError {
+		t.Fatalf("unexpected error: %v", getErrors(errAddr))
+	}
+	built := getValue(addr)
+	if built == nil {
+		t.Fatal("expected a registered value")
+	}
+	// Each package's value field holds its package name.
+	got, err := built.LookupPath(cue.ParsePath("value")).String()
+	if err != nil || got != instances[0].PkgName {
+		t.Fatalf("got (%q, %v), want (%q, nil)", got, err, instances[0].PkgName)
+	}
+}
+
+func TestFillPathInvalidPath(t *testing.T) {
+	ctx := newTestContext()
+	v := ctx.ctx.CompileString(`foo: int`)
+
+	_, errAddr := fillPath(&v, "foo.", "1")
+	if errAddr == noError {
+		t.Fatal("expected an error for a malformed path")
+	}
+}
+
+func TestFillPathTypeMismatch(t *testing.T) {
+	ctx := newTestContext()
+	v := ctx.ctx.CompileString(`foo: int`)
+
+	_, errAddr := fillPath(&v, "foo", `"not an int"`)
+	if errAddr == noError {
+		t.Fatal("expected an error filling an incompatible value")
+	}
+}
+
+func TestFillPathRoundTrip(t *testing.T) {
+	ctx := newTestContext()
+	v := ctx.ctx.CompileString(`foo: int`)
+
+	addr, errAddr := fillPath(&v, "foo", "42")
+	if errAddr != noError {
+		t.Fatalf("unexpected error: %v", getErrors(errAddr))
+	}
+	filled := getValue(addr)
+	if filled == nil {
+		t.Fatal("expected a registered value")
+	}
+	n, err := filled.LookupPath(cue.ParsePath("foo")).Int64()
+	if err != nil || n != 42 {
+		t.Fatalf("got (%v, %v), want (42, nil)", n, err)
+	}
+}
+
+func TestLookupPathMissingField(t *testing.T) {
+	ctx := newTestContext()
+	v := ctx.ctx.CompileString(`foo: int`)
+
+	_, errAddr := lookupPath(&v, "bar")
+	if errAddr == noError {
+		t.Fatal("expected an error looking up a field that doesn't exist")
+	}
+}
+
+func TestLookupPathInvalidPath(t *testing.T) {
+	ctx := newTestContext()
+	v := ctx.ctx.CompileString(`foo: int`)
+
+	_, errAddr := lookupPath(&v, "foo.")
+	if errAddr == noError {
+		t.Fatal("expected an error for a malformed path")
+	}
+}
+
+func TestLookupPathRoundTrip(t *testing.T) {
+	ctx := newTestContext()
+	v := ctx.ctx.CompileString(`foo: 42`)
+
+	addr, errAddr := lookupPath(&v, "foo")
+	if errAddr != noError {
+		t.Fatalf("unexpected error: %v", getErrors(errAddr))
+	}
+	looked := getValue(addr)
+	if looked == nil {
+		t.Fatal("expected a registered value")
+	}
+	n, err := looked.Int64()
+	if err != nil || n != 42 {
+		t.Fatalf("got (%v, %v), want (42, nil)", n, err)
+	}
+}